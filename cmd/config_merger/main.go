@@ -58,7 +58,7 @@ func gatherOptions() options {
 	var o options
 	flag.StringVar(&o.listPath, "config-list", "", "List of configurations to merge (at file)")
 	flag.StringVar(&o.listURL, "config-url", "", "List of configurations to merge (at web URL)")
-	flag.StringVar(&o.creds, "gcp-service-account", "", "/path/to/gcp/creds (use local creds if empty)")
+	flag.StringVar(&o.creds, "gcp-service-account", "", "/path/to/gcp/creds, an AWS profile name, or \"account:key\" for Azure (if empty, GCS and S3 use local/ambient creds)")
 	flag.BoolVar(&o.confirm, "confirm", false, "Upload data if set")
 	flag.DurationVar(&o.wait, "wait", 0, "Ensure at least this much time ahs passed since the last loop. (Run only once if zero)")
 	flag.BoolVar(&o.skipValidate, "allow-invalid-configs", false, "Allows merging of configs that don't validate. Usually skips invalid configs")
@@ -102,12 +102,9 @@ func main() {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	storageClient, err := gcs.ClientWithCreds(ctx, opt.creds)
-	if err != nil {
-		log.WithError(err).Fatalf("Can't make storage client")
-	}
-
-	client := gcs.NewClient(storageClient)
+	// client dispatches to GCS, S3, or Azure Blob per merge target's URL
+	// scheme, so a single merge list can span multiple clouds.
+	client := gcs.NewClient(opt.creds)
 
 	var reporter metrics.Reporter
 	cycle := reporter.Int64("cycle_duration", "Duration required for a component to complete one cycle (in seconds)", log, "component")
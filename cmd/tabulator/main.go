@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleCloudPlatform/testgrid/pkg/tabulator"
+	"github.com/GoogleCloudPlatform/testgrid/util/gcs"
+	"github.com/GoogleCloudPlatform/testgrid/util/metrics/prometheus"
+)
+
+const componentName = "tabulator"
+
+type options struct {
+	config            string
+	creds             string
+	concurrency       int
+	gridPathPrefix    string
+	tabsPathPrefix    string
+	dashboards        string
+	confirm           bool
+	filterData        bool
+	wait              time.Duration
+	requireSignedAt   string
+	signingKeyPath    string
+	signingKeyID      string
+	incremental       bool
+	maxGenerationSkew int64
+}
+
+func (o *options) validate(log logrus.FieldLogger) {
+	if o.config == "" {
+		log.Fatal("--config required")
+	}
+	if !o.confirm {
+		log.Info("--confirm=false (DRY-RUN): will not write to gcs")
+	}
+	if o.requireSignedAt != "" {
+		log.WithField("--require-signed", o.requireSignedAt).Info("Refusing to overwrite existing tab state whose signature doesn't chain to this trust root (a tab with no tab state yet is still written once, to bootstrap signing)")
+	}
+	if (o.signingKeyPath == "") != (o.signingKeyID == "") {
+		log.Fatal("--signing-key and --key-id must be set together")
+	}
+	if o.requireSignedAt != "" && o.signingKeyPath == "" {
+		log.Warn("--require-signed without --signing-key: this instance will refuse to overwrite untrusted tab state but never produces a signature of its own")
+	}
+}
+
+func gatherOptions() options {
+	var o options
+	flag.StringVar(&o.config, "config", "", "Path to the config proto (gs://, s3://, or azblob://)")
+	flag.StringVar(&o.creds, "gcp-service-account", "", "/path/to/gcp/creds, an AWS profile name, or \"account:key\" for Azure (if empty, GCS and S3 use local/ambient creds)")
+	flag.IntVar(&o.concurrency, "concurrency", runtime.NumCPU(), "Tabulate this many dashboards concurrently")
+	flag.StringVar(&o.gridPathPrefix, "grid-path-prefix", "grid", "Prefix for grid state paths")
+	flag.StringVar(&o.tabsPathPrefix, "tabs-path-prefix", "tabs", "Prefix for tab state paths")
+	flag.StringVar(&o.dashboards, "dashboards", "", "Comma-separated dashboards to tabulate (default: all dashboards in --config)")
+	flag.BoolVar(&o.confirm, "confirm", false, "Upload data if set")
+	flag.BoolVar(&o.filterData, "filter-data", true, "Remove data not needed to render the tab if set")
+	flag.DurationVar(&o.wait, "wait", 0, "Ensure at least this much time has passed since the last loop. (Run only once if zero)")
+	flag.StringVar(&o.requireSignedAt, "require-signed", "", "Path to a trust-root JSON (TUF root.json style) listing accepted signing keys; if set, refuses to overwrite existing tab state whose signature doesn't chain to it")
+	flag.StringVar(&o.signingKeyPath, "signing-key", "", "Path to a base64-encoded ed25519 private key; if set (with --key-id), sign every tab state written")
+	flag.StringVar(&o.signingKeyID, "key-id", "", "Key id to record in signatures produced by --signing-key, and to look up in --require-signed's trust root")
+	flag.BoolVar(&o.incremental, "incremental", false, "Diff tab state against a cursor instead of always rewriting it")
+	flag.Int64Var(&o.maxGenerationSkew, "max-generation-skew", 0, "In incremental mode, fall back to a full rewrite once the source grid has advanced this many generations past the cursor (0: no bound)")
+	flag.Parse()
+	return o
+}
+
+func main() {
+	log := logrus.WithField("component", componentName)
+	opt := gatherOptions()
+	opt.validate(log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// client dispatches to GCS, S3, or Azure Blob per path's URL scheme.
+	client := gcs.NewClient(opt.creds)
+
+	configPath, err := gcs.NewPath(opt.config)
+	if err != nil {
+		log.WithError(err).WithField("--config", opt.config).Fatal("Bad --config")
+	}
+
+	var dashboards []string
+	if opt.dashboards != "" {
+		dashboards = strings.Split(opt.dashboards, ",")
+	}
+
+	var signing tabulator.SigningOptions
+	if opt.requireSignedAt != "" {
+		trustRootPath, err := gcs.NewPath(opt.requireSignedAt)
+		if err != nil {
+			log.WithError(err).WithField("--require-signed", opt.requireSignedAt).Fatal("Bad --require-signed")
+		}
+		root, err := tabulator.LoadTrustRoot(ctx, client, *trustRootPath)
+		if err != nil {
+			log.WithError(err).WithField("--require-signed", opt.requireSignedAt).Fatal("Can't load trust root")
+		}
+		signing.TrustRoot = root
+	}
+	if opt.signingKeyPath != "" {
+		signer, err := tabulator.LoadEd25519Signer(opt.signingKeyID, opt.signingKeyPath)
+		if err != nil {
+			log.WithError(err).WithField("--signing-key", opt.signingKeyPath).Fatal("Can't load signing key")
+		}
+		signing.Signer = signer
+	}
+
+	incremental := tabulator.IncrementalOptions{
+		Enabled:           opt.incremental,
+		MaxGenerationSkew: opt.maxGenerationSkew,
+	}
+
+	http.Handle("/metrics", promhttp.Handler())
+	go http.ListenAndServe(":8080", nil)
+	mets := tabulator.CreateMetrics(prometheus.Factory{})
+
+	// Update loops internally at --wait cadence (or runs once if zero).
+	if err := tabulator.Update(ctx, client, mets, *configPath, opt.concurrency, opt.gridPathPrefix, opt.tabsPathPrefix, dashboards, opt.confirm, opt.filterData, opt.wait, nil, signing, incremental); err != nil {
+		log.WithError(err).Fatal("Update failed")
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabulator
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+// CodecMetadataKey is the object metadata key tabulate records the chosen
+// Codec's Name() under, so readers can pick the right decoder without a
+// full re-read.
+const CodecMetadataKey = "codec"
+
+// Codec compresses and decompresses tab/grid state.
+type Codec interface {
+	// Name identifies the codec, e.g. for CodecMetadataKey and CodecByName.
+	Name() string
+	// Encode wraps w, compressing everything written to the result.
+	Encode(w io.Writer) io.WriteCloser
+	// Decode wraps r, decompressing a stream this Codec previously Encoded.
+	Decode(r io.Reader) (io.ReadCloser, error)
+}
+
+// Supported codecs. ZlibCodec is the long-standing default.
+var (
+	ZlibCodec   Codec = zlibCodec{}
+	GzipCodec   Codec = gzipCodec{}
+	SnappyCodec Codec = snappyCodec{}
+	ZstdCodec   Codec = zstdCodec{}
+
+	codecsByName = map[string]Codec{
+		ZlibCodec.Name():   ZlibCodec,
+		GzipCodec.Name():   GzipCodec,
+		SnappyCodec.Name(): SnappyCodec,
+		ZstdCodec.Name():   ZstdCodec,
+	}
+)
+
+// CodecByName returns the Codec registered under name, falling back to
+// ZlibCodec if name is empty or unrecognized.
+func CodecByName(name string) Codec {
+	if c, ok := codecsByName[name]; ok {
+		return c
+	}
+	return ZlibCodec
+}
+
+// codecForTab resolves the per-DashboardTab codec override, read from a
+// "codec" key in the tab's base_options query string (the same field
+// filterGrid already reads feature flags from), falling back to def.
+func codecForTab(tab *configpb.DashboardTab, def Codec) Codec {
+	vals, err := url.ParseQuery(tab.GetBaseOptions())
+	if err != nil {
+		return def
+	}
+	if name := vals.Get("codec"); name != "" {
+		return CodecByName(name)
+	}
+	return def
+}
+
+// autodetect sniffs r's magic bytes to pick a Codec, so tab/grid state
+// written under any past or present codec continues to load regardless of
+// which codec is configured now.
+func autodetect(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("peek magic bytes: %w", err)
+	}
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return GzipCodec.Decode(br)
+	case len(magic) >= 4 && magic[0] == 0x28 && magic[1] == 0xb5 && magic[2] == 0x2f && magic[3] == 0xfd:
+		return ZstdCodec.Decode(br)
+	case len(magic) >= 1 && magic[0] == 0xff:
+		return SnappyCodec.Decode(br)
+	default:
+		// zlib, or too short to sniff: this has been the only format ever
+		// written before this codec abstraction existed.
+		return ZlibCodec.Decode(br)
+	}
+}
+
+type zlibCodec struct{}
+
+func (zlibCodec) Name() string { return "zlib" }
+func (zlibCodec) Encode(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+func (zlibCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("zlib.NewReader: %w", err)
+	}
+	return zr, nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+func (gzipCodec) Encode(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+func (gzipCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("gzip.NewReader: %w", err)
+	}
+	return zr, nil
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string { return "snappy" }
+func (snappyCodec) Encode(w io.Writer) io.WriteCloser { return snappy.NewBufferedWriter(w) }
+func (snappyCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(snappy.NewReader(r)), nil
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return "zstd" }
+func (zstdCodec) Encode(w io.Writer) io.WriteCloser {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		// Only invalid options cause NewWriter to fail, and we pass none.
+		panic(fmt.Sprintf("zstd.NewWriter: %v", err))
+	}
+	return zw
+}
+func (zstdCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("zstd.NewReader: %w", err)
+	}
+	return zr.IOReadCloser(), nil
+}
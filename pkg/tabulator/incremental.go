@@ -0,0 +1,210 @@
+/*
+Copyright 2022 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabulator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"google.golang.org/protobuf/proto"
+
+	statepb "github.com/GoogleCloudPlatform/testgrid/pb/state"
+	"github.com/GoogleCloudPlatform/testgrid/util/gcs"
+)
+
+// cursorSuffix names the small per-tab state-cursor object incremental mode
+// keeps so a cycle can tell whether the source grid (or the tab's filtering
+// config) changed at all, and if so, which rows need to be re-filtered. An
+// unchanged cycle is skipped entirely; a partially changed one still
+// rewrites the full tab state, just without re-filtering untouched rows.
+const cursorSuffix = ".cursor"
+
+// updateMode records how a tab's state was produced on a given cycle, for
+// Metrics.UpdateMode.
+type updateMode string
+
+const (
+	modeFull        updateMode = "full"
+	modeIncremental updateMode = "incremental"
+	modeSkipped     updateMode = "skipped"
+)
+
+// IncrementalOptions configures incremental tab-state updates: diffing
+// against a small state cursor instead of always rewriting the full grid.
+// The zero value disables incremental mode (the historical full-rewrite
+// behavior, still used as a fallback whenever the cursor is missing or
+// stale).
+type IncrementalOptions struct {
+	// Enabled turns on incremental mode.
+	Enabled bool
+	// MaxGenerationSkew bounds how many generations the source grid may
+	// have advanced since the cursor was written before incremental mode
+	// gives up and falls back to a full rewrite. Zero means no bound.
+	// Ignored for backends (like S3 or Azure) whose Generation isn't a
+	// GCS-style monotonic integer.
+	MaxGenerationSkew int64
+}
+
+// cursor records enough about the last successfully processed source grid
+// to decide whether a later cycle can skip or diff against it.
+type cursor struct {
+	// Generation is the source grid's Attrs.Generation as of this cursor.
+	Generation string `json:"generation"`
+	// ConfigHash digests the DashboardTab's base_options as of this cursor.
+	// A change invalidates both the skip and the diff path below, since a
+	// new filter can affect rows this cursor never saw change.
+	ConfigHash string `json:"configHash"`
+	// RowHashes maps each source row's name to a content hash, so the next
+	// cycle can detect additions, removals, and mutations without
+	// re-filtering every row.
+	RowHashes map[string]string `json:"rowHashes"`
+}
+
+// configHash digests a DashboardTab's base_options, so a cursor can tell
+// whether the tab's filtering configuration changed since it was written.
+func configHash(baseOptions string) string {
+	sum := sha256.Sum256([]byte(baseOptions))
+	return fmt.Sprintf("%x", sum)
+}
+
+func cursorPath(tabStatePath gcs.Path) (*gcs.Path, error) {
+	return gcs.NewPath(tabStatePath.String() + cursorSuffix)
+}
+
+func loadCursor(ctx context.Context, client gcs.Client, tabStatePath gcs.Path) (*cursor, error) {
+	path, err := cursorPath(tabStatePath)
+	if err != nil {
+		return nil, fmt.Errorf("cursorPath: %w", err)
+	}
+	r, _, err := client.Open(ctx, *path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path.String(), err)
+	}
+	var cur cursor
+	if err := json.Unmarshal(buf, &cur); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", path.String(), err)
+	}
+	return &cur, nil
+}
+
+func saveCursor(ctx context.Context, client gcs.Client, tabStatePath gcs.Path, cur *cursor) error {
+	path, err := cursorPath(tabStatePath)
+	if err != nil {
+		return fmt.Errorf("cursorPath: %w", err)
+	}
+	buf, err := json.Marshal(cur)
+	if err != nil {
+		return fmt.Errorf("marshal cursor: %w", err)
+	}
+	if _, err := client.Upload(ctx, *path, buf, false, "application/json", nil, gcs.Precondition{}); err != nil {
+		return fmt.Errorf("upload %s: %w", path.String(), err)
+	}
+	return nil
+}
+
+// withinSkew reports whether newGen has advanced past oldGen by no more
+// than maxSkew generations. Non-numeric generations (e.g. S3/Azure ETags)
+// always pass, since there is no meaningful distance to measure.
+func withinSkew(oldGen, newGen string, maxSkew int64) bool {
+	if maxSkew <= 0 {
+		return true
+	}
+	oldN, err1 := strconv.ParseInt(oldGen, 10, 64)
+	newN, err2 := strconv.ParseInt(newGen, 10, 64)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	return newN-oldN <= maxSkew
+}
+
+// rowHash content-addresses row, independent of its position in the grid.
+// ok is false if row could not be hashed, in which case the caller should
+// always treat it as changed rather than trust a stale comparison.
+func rowHash(row *statepb.Row) (hash string, ok bool) {
+	buf, err := proto.Marshal(row)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(buf)
+	return fmt.Sprintf("%x", sum), true
+}
+
+// hashRows content-addresses each row, for seeding a fresh cursor.
+func hashRows(rows []*statepb.Row) map[string]string {
+	hashes := make(map[string]string, len(rows))
+	for _, row := range rows {
+		hash, _ := rowHash(row)
+		hashes[row.GetName()] = hash
+	}
+	return hashes
+}
+
+// diffRows compares cur's row hashes against rows freshly read from the
+// source grid, returning the rows that are new or changed. A row that
+// couldn't be hashed is always reported as changed, regardless of what the
+// cursor last recorded for it.
+func diffRows(cur *cursor, rows []*statepb.Row) (changed []*statepb.Row, hashes map[string]string) {
+	hashes = make(map[string]string, len(rows))
+	for _, row := range rows {
+		name := row.GetName()
+		hash, ok := rowHash(row)
+		hashes[name] = hash
+		if old, known := cur.RowHashes[name]; !ok || !known || old != hash {
+			changed = append(changed, row)
+		}
+	}
+	return changed, hashes
+}
+
+// applyDiff merges filteredChanged (already filtered) rows with the rows
+// retained from the previously uploaded tab state (prevRows), preserving
+// order as it appears in the freshly read source grid. Rows no longer
+// present there (removed from the source) are dropped.
+//
+// changedNames lists every row the source grid reported as changed this
+// cycle, before filtering. A row in changedNames but absent from
+// filteredChanged newly failed the tab's filter (e.g. it stopped matching
+// the row filter), so its stale prevRows copy must be dropped rather than
+// carried forward.
+func applyDiff(order, prevRows []*statepb.Row, changedNames []string, filteredChanged []*statepb.Row) []*statepb.Row {
+	byName := make(map[string]*statepb.Row, len(prevRows)+len(filteredChanged))
+	for _, row := range prevRows {
+		byName[row.GetName()] = row
+	}
+	for _, name := range changedNames {
+		delete(byName, name)
+	}
+	for _, row := range filteredChanged {
+		byName[row.GetName()] = row
+	}
+	out := make([]*statepb.Row, 0, len(order))
+	for _, row := range order {
+		if r, ok := byName[row.GetName()]; ok {
+			out = append(out, r)
+		}
+	}
+	return out
+}
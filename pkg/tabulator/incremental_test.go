@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabulator
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	statepb "github.com/GoogleCloudPlatform/testgrid/pb/state"
+)
+
+func TestApplyDiff(t *testing.T) {
+	row := func(name string) *statepb.Row { return &statepb.Row{Name: name} }
+
+	cases := []struct {
+		name         string
+		order        []*statepb.Row
+		prevRows     []*statepb.Row
+		changedNames []string
+		filtered     []*statepb.Row
+		want         []*statepb.Row
+	}{
+		{
+			name:     "unchanged rows pass through",
+			order:    []*statepb.Row{row("a"), row("b")},
+			prevRows: []*statepb.Row{row("a"), row("b")},
+			want:     []*statepb.Row{row("a"), row("b")},
+		},
+		{
+			name:         "changed row still included is overlaid",
+			order:        []*statepb.Row{row("a"), row("b")},
+			prevRows:     []*statepb.Row{row("a"), row("b")},
+			changedNames: []string{"b"},
+			filtered:     []*statepb.Row{row("b")},
+			want:         []*statepb.Row{row("a"), row("b")},
+		},
+		{
+			// Cycle 1: "b" changed and still matched the tab filter.
+			// Cycle 2: "b" changed again but the filter now excludes it
+			// (e.g. it became all-passing). Its stale cycle-1 copy must be
+			// dropped, not carried forward from prevRows.
+			name:         "row flips from included to excluded",
+			order:        []*statepb.Row{row("a"), row("b")},
+			prevRows:     []*statepb.Row{row("a"), row("b")},
+			changedNames: []string{"b"},
+			filtered:     nil,
+			want:         []*statepb.Row{row("a")},
+		},
+		{
+			name:     "row removed from source grid is dropped",
+			order:    []*statepb.Row{row("a")},
+			prevRows: []*statepb.Row{row("a"), row("b")},
+			want:     []*statepb.Row{row("a")},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := applyDiff(tc.order, tc.prevRows, tc.changedNames, tc.filtered)
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("applyDiff() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
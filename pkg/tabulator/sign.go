@@ -0,0 +1,266 @@
+/*
+Copyright 2022 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabulator
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/util/gcs"
+)
+
+// SigningOptions configures the optional tab-state signing pipeline. The
+// zero value disables signing: tab state is written unsigned, as before
+// this pipeline existed.
+type SigningOptions struct {
+	// Signer, if non-nil, signs every newly written tab state.
+	Signer Signer
+	// TrustRoot, if non-nil, gates overwriting existing tab state: the
+	// write is refused unless the current object's signature chains to it
+	// (or no tab state exists yet).
+	TrustRoot *TrustRoot
+}
+
+// sigSuffix is appended to a tab state's path to name its signature
+// manifest, e.g. gs://bucket/dash/tab + sigSuffix.
+const sigSuffix = ".sig"
+
+// Signer signs a digest with a named key. This package implements it with a
+// local ed25519 key (NewEd25519Signer); it ships no KMS-backed
+// implementation, though one can satisfy the interface without exposing
+// the private key to this process.
+type Signer interface {
+	// KeyID identifies the key used to sign, recorded in the manifest so
+	// Verify knows which trust root entry to check against.
+	KeyID() string
+	// Algorithm names the signature scheme, e.g. "ed25519".
+	Algorithm() string
+	// Sign returns a signature over digest.
+	Sign(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// ed25519Signer is a Signer backed by a local private key.
+type ed25519Signer struct {
+	keyID string
+	priv  ed25519.PrivateKey
+}
+
+// NewEd25519Signer returns a Signer that signs with priv, identifying
+// itself as keyID in manifests it produces.
+func NewEd25519Signer(keyID string, priv ed25519.PrivateKey) Signer {
+	return &ed25519Signer{keyID: keyID, priv: priv}
+}
+
+func (s *ed25519Signer) KeyID() string     { return s.keyID }
+func (s *ed25519Signer) Algorithm() string { return "ed25519" }
+
+func (s *ed25519Signer) Sign(ctx context.Context, digest []byte) ([]byte, error) {
+	return ed25519.Sign(s.priv, digest), nil
+}
+
+// LoadEd25519Signer reads a base64-encoded raw ed25519 private key (a
+// 32-byte seed or a 64-byte expanded key as returned by
+// ed25519.GenerateKey) from a local file and returns a Signer that
+// identifies itself as keyID in manifests it produces. DER/PEM-wrapped keys
+// (such as "openssl genpkey" output) are rejected.
+func LoadEd25519Signer(keyID, keyPath string) (Signer, error) {
+	buf, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", keyPath, err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", keyPath, err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return NewEd25519Signer(keyID, ed25519.NewKeyFromSeed(raw)), nil
+	case ed25519.PrivateKeySize:
+		return NewEd25519Signer(keyID, ed25519.PrivateKey(raw)), nil
+	default:
+		return nil, fmt.Errorf("%s: want a %d- or %d-byte key, got %d bytes", keyPath, ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
+
+// Manifest is the sidecar object TestGrid writes alongside a tab state,
+// recording enough to verify the bytes were produced by an authorized
+// tabulator instance and haven't been tampered with since.
+type Manifest struct {
+	// Digest is the hex-encoded SHA-256 of the tab state object's bytes.
+	Digest string `json:"digest"`
+	// Algorithm names the signature scheme, e.g. "ed25519".
+	Algorithm string `json:"algorithm"`
+	// KeyID identifies the signing key, looked up in a TrustRoot by Verify.
+	KeyID string `json:"keyId"`
+	// Signature is the base64-encoded signature over the raw (not hex
+	// encoded) digest bytes.
+	Signature string `json:"signature"`
+	// SignedAt is when the tabulator produced this manifest.
+	SignedAt time.Time `json:"signedAt"`
+}
+
+// sigPath returns the path of tabStatePath's signature manifest.
+func sigPath(tabStatePath gcs.Path) (*gcs.Path, error) {
+	return gcs.NewPath(tabStatePath.String() + sigSuffix)
+}
+
+// Sign computes the SHA-256 digest of buf, signs it with signer, and
+// uploads the resulting Manifest alongside tabStatePath.
+func Sign(ctx context.Context, client gcs.Client, signer Signer, tabStatePath gcs.Path, buf []byte) error {
+	path, err := sigPath(tabStatePath)
+	if err != nil {
+		return fmt.Errorf("sigPath: %w", err)
+	}
+	sum := sha256.Sum256(buf)
+	sig, err := signer.Sign(ctx, sum[:])
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	manifest := Manifest{
+		Digest:    fmt.Sprintf("%x", sum),
+		Algorithm: signer.Algorithm(),
+		KeyID:     signer.KeyID(),
+		Signature: base64.StdEncoding.EncodeToString(sig),
+		SignedAt:  time.Now(),
+	}
+	out, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	if _, err := client.Upload(ctx, *path, out, false, "application/json", nil, gcs.Precondition{}); err != nil {
+		return fmt.Errorf("upload manifest %s: %w", path.String(), err)
+	}
+	return nil
+}
+
+// TrustedKey is a key accepted by a TrustRoot.
+type TrustedKey struct {
+	// PublicKey is the base64-encoded ed25519 public key.
+	PublicKey string `json:"publicKey"`
+	// Expires is when this key should no longer be trusted.
+	Expires time.Time `json:"expires"`
+}
+
+// TrustRoot lists the keys TestGrid accepts tab-state signatures from, TUF
+// root.json style: a small, separately-distributed JSON document operators
+// update out of band when rotating keys.
+type TrustRoot struct {
+	Keys map[string]TrustedKey `json:"keys"`
+}
+
+// LoadTrustRoot reads and parses the TrustRoot at path.
+func LoadTrustRoot(ctx context.Context, client gcs.Client, path gcs.Path) (*TrustRoot, error) {
+	r, _, err := client.Open(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("client.Open(%s): %w", path.String(), err)
+	}
+	defer r.Close()
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path.String(), err)
+	}
+	var root TrustRoot
+	if err := json.Unmarshal(buf, &root); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", path.String(), err)
+	}
+	return &root, nil
+}
+
+// ErrNotTrusted indicates a tab state's signature does not chain to the
+// configured TrustRoot: the manifest is missing, malformed, signed by an
+// unrecognized or expired key, or the signature does not verify.
+var ErrNotTrusted = errors.New("tab state signature does not chain to trust root")
+
+// Verify checks that the tab state at tabStatePath carries a Manifest whose
+// signature chains to root: a recognized, unexpired key, verifying over the
+// object's actual SHA-256 digest.
+//
+// A tab state that doesn't exist at all returns a wrapped
+// gcs.ErrObjectNotExist, so callers can tell a tab's first-ever write (there
+// is nothing signed yet to distrust) from every other failure. Once a tab
+// state exists, a missing, unreadable, or unparseable manifest is treated as
+// untrusted (ErrNotTrusted), not as bootstrap: deleting the .sig alongside
+// an existing tab state must not let a later pass overwrite it unchecked.
+func Verify(ctx context.Context, client gcs.Client, tabStatePath gcs.Path, root *TrustRoot) error {
+	stateR, _, err := client.Open(ctx, tabStatePath)
+	if err != nil {
+		return fmt.Errorf("client.Open(%s): %w", tabStatePath.String(), err)
+	}
+	defer stateR.Close()
+	buf, err := ioutil.ReadAll(stateR)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", tabStatePath.String(), err)
+	}
+
+	path, err := sigPath(tabStatePath)
+	if err != nil {
+		return fmt.Errorf("sigPath: %w", err)
+	}
+	manifestR, _, err := client.Open(ctx, *path)
+	if err != nil {
+		// tabStatePath exists (checked above) but its manifest doesn't, or
+		// can't be opened: that's tampering or a deleted manifest, not a
+		// first write, so it must not be treated as bootstrap.
+		return fmt.Errorf("%w: open manifest %s: %v", ErrNotTrusted, path.String(), err)
+	}
+	defer manifestR.Close()
+	manifestBuf, err := ioutil.ReadAll(manifestR)
+	if err != nil {
+		return fmt.Errorf("%w: read manifest %s: %v", ErrNotTrusted, path.String(), err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestBuf, &manifest); err != nil {
+		return fmt.Errorf("%w: unmarshal manifest %s: %v", ErrNotTrusted, path.String(), err)
+	}
+
+	sum := sha256.Sum256(buf)
+	if manifest.Digest != fmt.Sprintf("%x", sum) {
+		return fmt.Errorf("%w: digest mismatch", ErrNotTrusted)
+	}
+
+	key, ok := root.Keys[manifest.KeyID]
+	if !ok {
+		return fmt.Errorf("%w: unrecognized key id %q", ErrNotTrusted, manifest.KeyID)
+	}
+	if time.Now().After(key.Expires) {
+		return fmt.Errorf("%w: key id %q expired %s", ErrNotTrusted, manifest.KeyID, key.Expires)
+	}
+
+	if manifest.Algorithm != "ed25519" {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrNotTrusted, manifest.Algorithm)
+	}
+	pub, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		return fmt.Errorf("decode public key for %q: %w", manifest.KeyID, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: decode signature: %v", ErrNotTrusted, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), sum[:], sig) {
+		return fmt.Errorf("%w: signature does not verify", ErrNotTrusted)
+	}
+	return nil
+}
@@ -19,7 +19,6 @@ package tabulator
 
 import (
 	"bytes"
-	"compress/zlib"
 	"context"
 	"errors"
 	"fmt"
@@ -30,7 +29,6 @@ import (
 	"time"
 
 	"bitbucket.org/creachadair/stringset"
-	"cloud.google.com/go/storage"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/proto"
 
@@ -45,17 +43,34 @@ import (
 
 const componentName = "tabulator"
 
+// updateLatencyBucketsSeconds bounds the per-tab update-latency histogram;
+// tabulation is expected to take well under a minute per tab.
+var updateLatencyBucketsSeconds = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// gridSizeBucketsBytes bounds the per-tab grid-size histogram, spanning
+// small test groups up through the largest grids TestGrid hosts.
+var gridSizeBucketsBytes = []float64{1 << 10, 1 << 16, 1 << 20, 10 << 20, 50 << 20, 100 << 20, 500 << 20}
+
 // Metrics holds metrics relevant to this controller.
 type Metrics struct {
-	UpdateState  metrics.Cyclic
-	DelaySeconds metrics.Duration
+	UpdateState          metrics.Cyclic
+	DelaySeconds         metrics.Duration
+	UpdateLatencySeconds metrics.Histogram
+	GridSizeBytes        metrics.Histogram
+	// UpdateMode counts tab updates by how they were produced: full,
+	// incremental, or skipped (source grid unchanged). Labeled by
+	// dashboard and mode.
+	UpdateMode metrics.Counter
 }
 
 // CreateMetrics creates metrics for this controller
 func CreateMetrics(factory metrics.Factory) *Metrics {
 	return &Metrics{
-		UpdateState:  factory.NewCyclic(componentName),
-		DelaySeconds: factory.NewDuration("delay", "Seconds tabulator is behind schedule", "component"),
+		UpdateState:          factory.NewCyclic(componentName),
+		DelaySeconds:         factory.NewDuration("delay", "Seconds tabulator is behind schedule", "component"),
+		UpdateMode:           factory.NewCounter("update_mode", "Counts of full, incremental, and skipped tab updates", "dashboard", "mode"),
+		UpdateLatencySeconds: factory.NewHistogram("update_latency_seconds", "Time to tabulate a single dashboard tab", updateLatencyBucketsSeconds, "dashboard"),
+		GridSizeBytes:        factory.NewHistogram("grid_size_bytes", "Uncompressed size of a tab's grid", gridSizeBucketsBytes, "dashboard", "tab"),
 	}
 }
 
@@ -65,8 +80,21 @@ type Fixer func(context.Context, *config.DashboardQueue) error
 // Update tab state with the given frequency continuously. If freq == 0, runs only once.
 //
 // Copies the grid into the tab state. If filter is set, will remove unneeded data.
-// Runs on each dashboard in allowedDashboards, or all of them in the config if not specified
-func Update(ctx context.Context, client gcs.ConditionalClient, mets *Metrics, configPath gcs.Path, concurrency int, gridPathPrefix, tabsPathPrefix string, allowedDashboards []string, confirm, filter bool, freq time.Duration, fixers ...Fixer) error {
+// Runs on each dashboard in allowedDashboards, or all of them in the config if not specified.
+//
+// codec selects the compression used for newly written tab state; pass nil
+// for the default (ZlibCodec). A DashboardTab may override codec via a
+// "codec" key in its base_options.
+//
+// signing configures the optional signing pipeline; its zero value leaves
+// tab state unsigned, as before.
+//
+// incremental configures incremental mode; its zero value always does a
+// full rewrite, as before.
+func Update(ctx context.Context, client gcs.ConditionalClient, mets *Metrics, configPath gcs.Path, concurrency int, gridPathPrefix, tabsPathPrefix string, allowedDashboards []string, confirm, filter bool, freq time.Duration, codec Codec, signing SigningOptions, incremental IncrementalOptions, fixers ...Fixer) error {
+	if codec == nil {
+		codec = ZlibCodec
+	}
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -193,7 +221,7 @@ func Update(ctx context.Context, client gcs.ConditionalClient, mets *Metrics, co
 				// copy-only mode
 				_, err = client.Copy(ctx, *fromPath, *toPath)
 				if err != nil {
-					if errors.Is(err, storage.ErrObjectNotExist) {
+					if errors.Is(err, gcs.ErrObjectNotExist) {
 						log.WithError(err).Info("Original state does not exist.")
 					} else {
 						return fmt.Errorf("can't copy from %q to %q: %w", fromPath.String(), toPath.String(), err)
@@ -201,9 +229,15 @@ func Update(ctx context.Context, client gcs.ConditionalClient, mets *Metrics, co
 				}
 			}
 			if filter {
-				err := tabulate(ctx, client, tab, *fromPath, *toPath, confirm)
+				tabStart := time.Now()
+				gridSize, mode, err := tabulate(ctx, client, tab, *fromPath, *toPath, confirm, codecForTab(tab, codec), signing, incremental)
+				mets.UpdateLatencySeconds.Observe(time.Since(tabStart).Seconds(), dashName)
+				mets.UpdateMode.Add(1, dashName, string(mode))
+				if gridSize > 0 {
+					mets.GridSizeBytes.Observe(float64(gridSize), dashName, tab.GetName())
+				}
 				if err != nil {
-					if errors.Is(errors.Unwrap(err), storage.ErrObjectNotExist) {
+					if errors.Is(errors.Unwrap(err), gcs.ErrObjectNotExist) {
 						log.WithError(err).Info("Original state does not exist")
 					} else {
 						return fmt.Errorf("can't calculate state: %w", err)
@@ -259,7 +293,8 @@ func Update(ctx context.Context, client gcs.ConditionalClient, mets *Metrics, co
 	return q.Send(ctx, dashboardNames, freq)
 }
 
-// TabStatePath returns the path for a given tab.
+// TabStatePath returns the path for a given tab. configPath's scheme (gs://,
+// s3://, or azblob://) determines which storage backend holds the tab state.
 func TabStatePath(configPath gcs.Path, tabPrefix, dashboardName, tabName string) (*gcs.Path, error) {
 	name := path.Join(tabPrefix, dashboardName, tabName)
 	u, err := url.Parse(name)
@@ -276,50 +311,166 @@ func TabStatePath(configPath gcs.Path, tabPrefix, dashboardName, tabName string)
 	return np, nil
 }
 
-func tabulate(ctx context.Context, client gcs.Client, cfg *configpb.DashboardTab, testGroupPath, tabStatePath gcs.Path, confirm bool) error {
-	r, _, err := client.Open(ctx, testGroupPath)
+// tabulate reads the grid at testGroupPath, filters it per cfg, and (if
+// confirm) writes the result to tabStatePath. It returns the uncompressed
+// size of the filtered grid in bytes (for Metrics.GridSizeBytes) and which
+// path it took (for Metrics.UpdateMode). The size is 0 when nothing is
+// written: on a dry run (!confirm), a skipped cycle, or an error.
+func tabulate(ctx context.Context, client gcs.Client, cfg *configpb.DashboardTab, testGroupPath, tabStatePath gcs.Path, confirm bool, codec Codec, signing SigningOptions, incremental IncrementalOptions) (int, updateMode, error) {
+	r, srcAttrs, err := client.Open(ctx, testGroupPath)
 	if err != nil {
-		return fmt.Errorf("client.Open(%s): %w", testGroupPath.String(), err)
+		return 0, modeFull, fmt.Errorf("client.Open(%s): %w", testGroupPath.String(), err)
 	}
 	defer r.Close()
-	z, err := zlib.NewReader(r)
+
+	var cur *cursor
+	var cfgHash string
+	if incremental.Enabled {
+		cfgHash = configHash(cfg.GetBaseOptions())
+		c, err := loadCursor(ctx, client, tabStatePath)
+		switch {
+		case err == nil:
+			cur = c
+		case errors.Is(err, gcs.ErrObjectNotExist):
+			// No cursor yet: fall back to a full rewrite below, which will
+			// establish one.
+		default:
+			return 0, modeFull, fmt.Errorf("loadCursor: %w", err)
+		}
+		if cur != nil && cur.Generation == srcAttrs.Generation && cur.ConfigHash == cfgHash {
+			return 0, modeSkipped, nil
+		}
+		if cur != nil && cur.ConfigHash != cfgHash {
+			// The tab's filtering config changed since the cursor was
+			// written: a diff against old row hashes can't tell us which
+			// rows the new config now includes or excludes, so fall back
+			// to a full rewrite, which re-filters everything.
+			cur = nil
+		}
+	}
+
+	z, err := autodetect(r)
 	if err != nil {
-		return fmt.Errorf("zlib.NewReader: %w", err)
+		return 0, modeFull, fmt.Errorf("autodetect: %w", err)
 	}
 	defer z.Close()
 	buf, err := ioutil.ReadAll(z)
 	if err != nil {
-		return fmt.Errorf("ioutil.ReadAll: %w", err)
+		return 0, modeFull, fmt.Errorf("ioutil.ReadAll: %w", err)
 	}
 	var g statepb.Grid
 	if err = proto.Unmarshal(buf, &g); err != nil {
-		return fmt.Errorf("proto.Unmarshal: %w", err)
+		return 0, modeFull, fmt.Errorf("proto.Unmarshal: %w", err)
 	}
 
-	newRows, err := filterGrid(cfg.GetBaseOptions(), g.GetRows())
-	if err != nil {
-		return fmt.Errorf("filterGrid: %w", err)
+	mode := modeFull
+	var newRows []*statepb.Row
+	var nextHashes map[string]string
+	if cur != nil && withinSkew(cur.Generation, srcAttrs.Generation, incremental.MaxGenerationSkew) {
+		changed, hashes := diffRows(cur, g.GetRows())
+		filteredChanged, err := filterGrid(cfg.GetBaseOptions(), changed)
+		if err != nil {
+			return 0, modeFull, fmt.Errorf("filterGrid (incremental): %w", err)
+		}
+		prev, err := readPreviousRows(ctx, client, tabStatePath)
+		if err != nil {
+			return 0, modeFull, fmt.Errorf("readPreviousRows: %w", err)
+		}
+		changedNames := make([]string, 0, len(changed))
+		for _, row := range changed {
+			changedNames = append(changedNames, row.GetName())
+		}
+		newRows = applyDiff(g.GetRows(), prev, changedNames, filteredChanged)
+		nextHashes = hashes
+		mode = modeIncremental
+	} else {
+		rows, err := filterGrid(cfg.GetBaseOptions(), g.GetRows())
+		if err != nil {
+			return 0, modeFull, fmt.Errorf("filterGrid: %w", err)
+		}
+		newRows = rows
+		if incremental.Enabled {
+			nextHashes = hashRows(g.GetRows())
+		}
 	}
 	g.Rows = newRows
 
-	if confirm {
-		buf, err = proto.Marshal(&g)
-		if err != nil {
-			return fmt.Errorf("proto.Marshal: %w", err)
+	if !confirm {
+		return 0, mode, nil
+	}
+
+	if signing.TrustRoot != nil {
+		// Verify only returns a wrapped ErrObjectNotExist when tabStatePath
+		// itself doesn't exist yet (a tab's first-ever write, with nothing
+		// signed yet to distrust); a tab state that exists but has a
+		// missing, unreadable, or unparseable manifest comes back as
+		// ErrNotTrusted instead, and is refused below like any other
+		// untrusted signature. See Verify's doc comment.
+		if err := Verify(ctx, client, tabStatePath, signing.TrustRoot); err != nil {
+			if !errors.Is(err, gcs.ErrObjectNotExist) {
+				return 0, mode, fmt.Errorf("refusing to overwrite %s: %w", tabStatePath.String(), err)
+			}
 		}
+	}
 
-		var zbuf bytes.Buffer
-		zw := zlib.NewWriter(&zbuf)
-		_, err = zw.Write(buf)
-		if err != nil {
-			return fmt.Errorf("zlib.Write: %w", err)
+	buf, err = proto.Marshal(&g)
+	if err != nil {
+		return 0, mode, fmt.Errorf("proto.Marshal: %w", err)
+	}
+
+	var zbuf bytes.Buffer
+	zw := codec.Encode(&zbuf)
+	_, err = zw.Write(buf)
+	if err != nil {
+		return 0, mode, fmt.Errorf("%s.Write: %w", codec.Name(), err)
+	}
+	zw.Close()
+
+	metadata := map[string]string{CodecMetadataKey: codec.Name()}
+	if _, err := client.Upload(ctx, tabStatePath, zbuf.Bytes(), false, "", metadata, gcs.Precondition{}); err != nil {
+		return 0, mode, fmt.Errorf("client.Upload(%s): %w", tabStatePath.String(), err)
+	}
+
+	if signing.Signer != nil {
+		if err := Sign(ctx, client, signing.Signer, tabStatePath, zbuf.Bytes()); err != nil {
+			return 0, mode, fmt.Errorf("sign %s: %w", tabStatePath.String(), err)
 		}
-		zw.Close()
+	}
 
-		_, err = client.Upload(ctx, tabStatePath, zbuf.Bytes(), false, "")
-		if err != nil {
-			return fmt.Errorf("client.Upload(%s): %w", tabStatePath.String(), err)
+	if incremental.Enabled {
+		next := &cursor{Generation: srcAttrs.Generation, ConfigHash: cfgHash, RowHashes: nextHashes}
+		if err := saveCursor(ctx, client, tabStatePath, next); err != nil {
+			return 0, mode, fmt.Errorf("saveCursor: %w", err)
+		}
+	}
+
+	return len(buf), mode, nil
+}
+
+// readPreviousRows reads back the rows of the tab state last uploaded to
+// tabStatePath, for incremental mode to diff against. A missing tab state
+// is treated as having no previous rows.
+func readPreviousRows(ctx context.Context, client gcs.Client, tabStatePath gcs.Path) ([]*statepb.Row, error) {
+	r, _, err := client.Open(ctx, tabStatePath)
+	if err != nil {
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("client.Open(%s): %w", tabStatePath.String(), err)
+	}
+	defer r.Close()
+	z, err := autodetect(r)
+	if err != nil {
+		return nil, fmt.Errorf("autodetect: %w", err)
+	}
+	defer z.Close()
+	buf, err := ioutil.ReadAll(z)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll: %w", err)
+	}
+	var g statepb.Grid
+	if err := proto.Unmarshal(buf, &g); err != nil {
+		return nil, fmt.Errorf("proto.Unmarshal: %w", err)
 	}
-	return nil
+	return g.GetRows(), nil
 }
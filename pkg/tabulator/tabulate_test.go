@@ -0,0 +1,192 @@
+/*
+Copyright 2023 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabulator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	statepb "github.com/GoogleCloudPlatform/testgrid/pb/state"
+	"github.com/GoogleCloudPlatform/testgrid/util/gcs"
+)
+
+// fakeObject is one object held by fakeClient, versioned like a real
+// backend so incremental mode's generation bookkeeping has something real
+// to compare against.
+type fakeObject struct {
+	buf        []byte
+	generation int
+	metadata   map[string]string
+}
+
+// fakeClient is a minimal in-memory gcs.Client, just enough of Open/Upload/
+// Copy to drive tabulate() end to end without a real object store.
+type fakeClient struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{objects: map[string]fakeObject{}}
+}
+
+func (f *fakeClient) Open(ctx context.Context, path gcs.Path) (io.ReadCloser, *gcs.Attrs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[path.String()]
+	if !ok {
+		return nil, nil, fmt.Errorf("open %s: %w", path.String(), gcs.ErrObjectNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(obj.buf)), &gcs.Attrs{Generation: strconv.Itoa(obj.generation), Metadata: obj.metadata}, nil
+}
+
+func (f *fakeClient) Upload(ctx context.Context, path gcs.Path, buf []byte, worldReadable bool, cacheControl string, metadata map[string]string, precondition gcs.Precondition) (*gcs.Attrs, error) {
+	return f.upload(path, buf, metadata), nil
+}
+
+func (f *fakeClient) Copy(ctx context.Context, from, to gcs.Path) (*gcs.Attrs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[from.String()]
+	if !ok {
+		return nil, fmt.Errorf("copy %s: %w", from.String(), gcs.ErrObjectNotExist)
+	}
+	f.objects[to.String()] = obj
+	return &gcs.Attrs{Generation: strconv.Itoa(obj.generation), Metadata: obj.metadata}, nil
+}
+
+func (f *fakeClient) upload(path gcs.Path, buf []byte, metadata map[string]string) *gcs.Attrs {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj := f.objects[path.String()]
+	obj.buf = append([]byte(nil), buf...)
+	obj.generation++
+	obj.metadata = metadata
+	f.objects[path.String()] = obj
+	return &gcs.Attrs{Generation: strconv.Itoa(obj.generation), Metadata: obj.metadata}
+}
+
+// uploadGrid zlib-encodes grid and writes it to path, bumping path's
+// generation as a real source-grid write would.
+func uploadGrid(t *testing.T, client *fakeClient, path gcs.Path, grid *statepb.Grid) {
+	t.Helper()
+	buf, err := proto.Marshal(grid)
+	if err != nil {
+		t.Fatalf("proto.Marshal(%s): %v", path.String(), err)
+	}
+	var zbuf bytes.Buffer
+	zw := ZlibCodec.Encode(&zbuf)
+	if _, err := zw.Write(buf); err != nil {
+		t.Fatalf("ZlibCodec.Write(%s): %v", path.String(), err)
+	}
+	zw.Close()
+	client.upload(path, zbuf.Bytes(), nil)
+}
+
+// TestTabulateIncrementalMatchesFull verifies that, for a real grid and a
+// non-trivial base_options filter, two incremental cycles land on the same
+// tab state as a single full rewrite of the final grid. Incremental mode
+// only re-filters the rows diffRows reports as changed (see tabstate.go's
+// incremental branch), so this would miss a case where filterGrid's
+// decision for a row depends on more than that row's own bytes.
+func TestTabulateIncrementalMatchesFull(t *testing.T) {
+	ctx := context.Background()
+	cfg := &configpb.DashboardTab{
+		Name:          "tab",
+		TestGroupName: "tg",
+		BaseOptions:   "exclude-filter-by-regex=^noisy-",
+	}
+
+	testGroupPath, err := gcs.NewPath("gs://bucket/grid/tg")
+	if err != nil {
+		t.Fatalf("NewPath: %v", err)
+	}
+
+	row := func(name, message string) *statepb.Row {
+		return &statepb.Row{Name: name, Messages: []string{message}}
+	}
+
+	cycle1 := &statepb.Grid{Rows: []*statepb.Row{
+		row("job-a", "v1"),
+		row("job-b", "v1"),
+		row("noisy-c", "v1"),
+	}}
+	cycle2 := &statepb.Grid{Rows: []*statepb.Row{
+		row("job-a", "v1"),   // unchanged
+		row("job-b", "v2"),   // changed, still passes the filter
+		row("job-d", "v1"),   // new, passes the filter
+		row("noisy-e", "v1"), // new, excluded by the filter
+		// noisy-c and job-b's old value are gone from this cycle's grid.
+	}}
+
+	// Two incremental cycles against the same tab state.
+	incClient := newFakeClient()
+	incTabPath, err := gcs.NewPath("gs://bucket/tabs/dash/tab")
+	if err != nil {
+		t.Fatalf("NewPath: %v", err)
+	}
+	incOpts := IncrementalOptions{Enabled: true}
+
+	uploadGrid(t, incClient, *testGroupPath, cycle1)
+	if _, mode, err := tabulate(ctx, incClient, cfg, *testGroupPath, *incTabPath, true, ZlibCodec, SigningOptions{}, incOpts); err != nil {
+		t.Fatalf("tabulate() cycle 1: %v", err)
+	} else if mode != modeFull {
+		t.Fatalf("tabulate() cycle 1 mode = %q, want %q (first cycle always bootstraps the cursor)", mode, modeFull)
+	}
+
+	uploadGrid(t, incClient, *testGroupPath, cycle2)
+	if _, mode, err := tabulate(ctx, incClient, cfg, *testGroupPath, *incTabPath, true, ZlibCodec, SigningOptions{}, incOpts); err != nil {
+		t.Fatalf("tabulate() cycle 2: %v", err)
+	} else if mode != modeIncremental {
+		t.Fatalf("tabulate() cycle 2 mode = %q, want %q (cursor from cycle 1 should let this diff)", mode, modeIncremental)
+	}
+	incRows, err := readPreviousRows(ctx, incClient, *incTabPath)
+	if err != nil {
+		t.Fatalf("readPreviousRows(incremental): %v", err)
+	}
+
+	// A single full rewrite of the same final grid, from scratch.
+	fullClient := newFakeClient()
+	fullTabPath, err := gcs.NewPath("gs://bucket/tabs/dash/tab-full")
+	if err != nil {
+		t.Fatalf("NewPath: %v", err)
+	}
+	uploadGrid(t, fullClient, *testGroupPath, cycle2)
+	if _, mode, err := tabulate(ctx, fullClient, cfg, *testGroupPath, *fullTabPath, true, ZlibCodec, SigningOptions{}, IncrementalOptions{}); err != nil {
+		t.Fatalf("tabulate() full rewrite: %v", err)
+	} else if mode != modeFull {
+		t.Fatalf("tabulate() full rewrite mode = %q, want %q", mode, modeFull)
+	}
+	fullRows, err := readPreviousRows(ctx, fullClient, *fullTabPath)
+	if err != nil {
+		t.Fatalf("readPreviousRows(full): %v", err)
+	}
+
+	if diff := cmp.Diff(fullRows, incRows, protocmp.Transform()); diff != "" {
+		t.Errorf("incremental tab state diverged from a full rewrite of the same grid (-full +incremental):\n%s", diff)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// azblobClient implements Client atop Azure Blob Storage. Conditional
+// writes use Azure's If-Match / If-None-Match access conditions in place
+// of GCS generation preconditions; containers play the role of buckets.
+type azblobClient struct {
+	account string
+	creds   azblob.Credential
+}
+
+func newAzblobClient(ctx context.Context, creds string) (Client, error) {
+	account := accountFromCreds(creds)
+	cred, err := azblob.NewSharedKeyCredential(account, keyFromCreds(creds))
+	if err != nil {
+		return nil, fmt.Errorf("azblob.NewSharedKeyCredential: %w", err)
+	}
+	return &azblobClient{account: account, creds: cred}, nil
+}
+
+// blobURL resolves path to a blob. The storage account always comes from
+// the client's credentials, never from path; path.Bucket() names the
+// container within that account (azblob://container/object), which may
+// differ from the account name. Deriving the account from path instead
+// would desync it from the SharedKeyCredential's account and make every
+// request's signature invalid.
+func (a *azblobClient) blobURL(path Path) azblob.BlockBlobURL {
+	pipeline := azblob.NewPipeline(a.creds, azblob.PipelineOptions{})
+	u, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", a.account, path.Bucket(), path.Object()))
+	return azblob.NewBlockBlobURL(*u, pipeline)
+}
+
+func (a *azblobClient) Open(ctx context.Context, path Path) (io.ReadCloser, *Attrs, error) {
+	resp, err := a.blobURL(path).Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		if stgErr, ok := err.(azblob.StorageError); ok && stgErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+			return nil, nil, fmt.Errorf("%s: %w", path.String(), ErrObjectNotExist)
+		}
+		return nil, nil, fmt.Errorf("Download(%s): %w", path.String(), err)
+	}
+	body := resp.Body(azblob.RetryReaderOptions{})
+	return body, &Attrs{Generation: string(resp.ETag()), Metadata: resp.NewMetadata()}, nil
+}
+
+func (a *azblobClient) Upload(ctx context.Context, path Path, buf []byte, worldReadable bool, cacheControl string, metadata map[string]string, precondition Precondition) (*Attrs, error) {
+	var cond azblob.BlobAccessConditions
+	switch {
+	case precondition.IfAbsent:
+		cond.ModifiedAccessConditions.IfNoneMatch = azblob.ETagAny
+	case precondition.Generation != "":
+		cond.ModifiedAccessConditions.IfMatch = azblob.ETag(precondition.Generation)
+	}
+
+	headers := azblob.BlobHTTPHeaders{CacheControl: cacheControl}
+	resp, err := a.blobURL(path).Upload(ctx, bytes.NewReader(buf), headers, azblob.Metadata(metadata), cond, azblob.DefaultAccessTier, nil, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Upload(%s): %w", path.String(), err)
+	}
+	return &Attrs{Generation: string(resp.ETag())}, nil
+}
+
+func (a *azblobClient) Copy(ctx context.Context, from, to Path) (*Attrs, error) {
+	src := a.blobURL(from).URL()
+	resp, err := a.blobURL(to).StartCopyFromURL(ctx, src, azblob.Metadata{}, azblob.ModifiedAccessConditions{}, azblob.BlobAccessConditions{}, azblob.DefaultAccessTier, nil)
+	if err != nil {
+		if stgErr, ok := err.(azblob.StorageError); ok && stgErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+			return nil, fmt.Errorf("%s: %w", from.String(), ErrObjectNotExist)
+		}
+		return nil, fmt.Errorf("copy %s -> %s: %w", from.String(), to.String(), err)
+	}
+	return &Attrs{Generation: string(resp.ETag())}, nil
+}
+
+// accountFromCreds and keyFromCreds parse an "account:key" credentials
+// string, TestGrid's convention for passing Azure shared-key credentials
+// through the existing single --gcp-service-account-style flag.
+func accountFromCreds(creds string) string {
+	account, _ := splitCreds(creds)
+	return account
+}
+
+func keyFromCreds(creds string) string {
+	_, key := splitCreds(creds)
+	return key
+}
+
+func splitCreds(creds string) (string, string) {
+	for i := 0; i < len(creds); i++ {
+		if creds[i] == ':' {
+			return creds[:i], creds[i+1:]
+		}
+	}
+	return creds, ""
+}
+
@@ -0,0 +1,52 @@
+/*
+Copyright 2023 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAzblobClientBlobURL(t *testing.T) {
+	ctx := context.Background()
+	// The account name (from creds) and the container name (from the path)
+	// are deliberately different here, so a regression that conflates them
+	// (or signs for the wrong account) shows up as a wrong URL rather than
+	// passing by coincidence.
+	client, err := newAzblobClient(ctx, "myaccount:bXlrZXk=")
+	if err != nil {
+		t.Fatalf("newAzblobClient() errored: %v", err)
+	}
+	a, ok := client.(*azblobClient)
+	if !ok {
+		t.Fatalf("newAzblobClient() returned %T, want *azblobClient", client)
+	}
+	if a.account != "myaccount" {
+		t.Errorf("account = %q, want %q", a.account, "myaccount")
+	}
+
+	path, err := NewPath("azblob://my-container/dir/object.txt")
+	if err != nil {
+		t.Fatalf("NewPath() errored: %v", err)
+	}
+
+	got := a.blobURL(*path).URL().String()
+	want := "https://myaccount.blob.core.windows.net/my-container/dir/object.txt"
+	if got != want {
+		t.Errorf("blobURL() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrObjectNotExist is returned (wrapped) by Open when the requested object
+// does not exist, regardless of which backend holds it.
+var ErrObjectNotExist = errors.New("object does not exist")
+
+// Attrs generalizes the backend-specific metadata TestGrid needs for an
+// object, independent of whether the bytes live in GCS, S3, or Azure Blob.
+type Attrs struct {
+	// Generation is an opaque, backend-specific token identifying this
+	// object revision: a GCS generation number (formatted as decimal), or
+	// an S3/Azure ETag. Treat it as opaque; only compare it for equality or
+	// feed it back into a Precondition.
+	Generation string
+	// Metadata holds backend object metadata, e.g. a codec recorded by the
+	// tabulator so readers can pick the right decoder.
+	Metadata map[string]string
+}
+
+// Precondition constrains an Upload to only succeed if the target object's
+// current state matches, translated to each backend's native mechanism:
+// GCS generation match, S3/Azure If-Match, or If-None-Match.
+type Precondition struct {
+	// Generation, if non-empty, requires the object's current Generation to
+	// equal this value before the write is allowed.
+	Generation string
+	// IfAbsent, if true, requires that the object not already exist.
+	IfAbsent bool
+}
+
+// Client reads and writes objects at a Path, independent of cloud backend.
+type Client interface {
+	// Open returns a reader for the object at path along with its attributes.
+	Open(ctx context.Context, path Path) (io.ReadCloser, *Attrs, error)
+	// Upload writes buf to path, subject to precondition. metadata is
+	// stored as backend object metadata (e.g. the codec used to write buf).
+	Upload(ctx context.Context, path Path, buf []byte, worldReadable bool, cacheControl string, metadata map[string]string, precondition Precondition) (*Attrs, error)
+	// Copy copies the object at from to to.
+	Copy(ctx context.Context, from, to Path) (*Attrs, error)
+}
+
+// ConditionalClient is a Client whose Upload enforces the requested
+// Precondition rather than silently ignoring it. GCS, S3, and Azure Blob all
+// satisfy this.
+type ConditionalClient interface {
+	Client
+}
+
+// backendFor constructs the Client for path's scheme.
+func backendFor(ctx context.Context, scheme, creds string) (Client, error) {
+	switch scheme {
+	case "", "gs":
+		return newGCSClient(ctx, creds)
+	case "s3":
+		return newS3Client(ctx, creds)
+	case "azblob":
+		return newAzblobClient(ctx, creds)
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q, want one of gs://, s3://, azblob://", scheme)
+	}
+}
+
+// multiClient dispatches to a backend Client based on each path's scheme,
+// lazily constructing (and caching) one backend client per scheme so a
+// single Client can serve dashboards whose tab state is split across
+// clouds.
+type multiClient struct {
+	creds string
+
+	mu       sync.Mutex
+	backends map[string]Client
+}
+
+// NewClient returns a ConditionalClient that reads and writes gs://, s3://,
+// and azblob:// paths, using creds (if non-empty) to authenticate with
+// whichever backend a given path's scheme selects.
+func NewClient(creds string) ConditionalClient {
+	return &multiClient{creds: creds, backends: map[string]Client{}}
+}
+
+func (m *multiClient) backend(ctx context.Context, scheme string) (Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.backends[scheme]; ok {
+		return c, nil
+	}
+	c, err := backendFor(ctx, scheme, m.creds)
+	if err != nil {
+		return nil, err
+	}
+	m.backends[scheme] = c
+	return c, nil
+}
+
+func (m *multiClient) Open(ctx context.Context, path Path) (io.ReadCloser, *Attrs, error) {
+	c, err := m.backend(ctx, path.Scheme())
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.Open(ctx, path)
+}
+
+func (m *multiClient) Upload(ctx context.Context, path Path, buf []byte, worldReadable bool, cacheControl string, metadata map[string]string, precondition Precondition) (*Attrs, error) {
+	c, err := m.backend(ctx, path.Scheme())
+	if err != nil {
+		return nil, err
+	}
+	return c.Upload(ctx, path, buf, worldReadable, cacheControl, metadata, precondition)
+}
+
+func (m *multiClient) Copy(ctx context.Context, from, to Path) (*Attrs, error) {
+	if from.Scheme() != to.Scheme() {
+		return nil, fmt.Errorf("cannot copy across backends: %s -> %s", from.String(), to.String())
+	}
+	c, err := m.backend(ctx, from.Scheme())
+	if err != nil {
+		return nil, err
+	}
+	return c.Copy(ctx, from, to)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// gcsClient implements Client atop Google Cloud Storage. This is the
+// original, default TestGrid backend.
+type gcsClient struct {
+	client *storage.Client
+}
+
+func newGCSClient(ctx context.Context, creds string) (Client, error) {
+	var opts []option.ClientOption
+	if creds != "" {
+		opts = append(opts, option.WithCredentialsFile(creds))
+	}
+	c, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("storage.NewClient: %w", err)
+	}
+	return &gcsClient{client: c}, nil
+}
+
+func (g *gcsClient) object(p Path) *storage.ObjectHandle {
+	return g.client.Bucket(p.Bucket()).Object(p.Object())
+}
+
+func (g *gcsClient) Open(ctx context.Context, path Path) (io.ReadCloser, *Attrs, error) {
+	r, err := g.object(path).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, nil, fmt.Errorf("%s: %w", path.String(), ErrObjectNotExist)
+		}
+		return nil, nil, fmt.Errorf("NewReader(%s): %w", path.String(), err)
+	}
+	return r, &Attrs{
+		Generation: strconv.FormatInt(r.Attrs.Generation, 10),
+		Metadata:   r.Attrs.Metadata,
+	}, nil
+}
+
+func (g *gcsClient) Upload(ctx context.Context, path Path, buf []byte, worldReadable bool, cacheControl string, metadata map[string]string, precondition Precondition) (*Attrs, error) {
+	obj := g.object(path)
+	switch {
+	case precondition.IfAbsent:
+		obj = obj.If(storage.Conditions{DoesNotExist: true})
+	case precondition.Generation != "":
+		gen, err := strconv.ParseInt(precondition.Generation, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("precondition generation %q is not a GCS generation: %w", precondition.Generation, err)
+		}
+		obj = obj.If(storage.Conditions{GenerationMatch: gen})
+	}
+
+	w := obj.NewWriter(ctx)
+	if cacheControl != "" {
+		w.CacheControl = cacheControl
+	}
+	if len(metadata) != 0 {
+		w.Metadata = metadata
+	}
+	if worldReadable {
+		w.PredefinedACL = "publicRead"
+	}
+	if _, err := w.Write(buf); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("write(%s): %w", path.String(), err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("close(%s): %w", path.String(), err)
+	}
+	return &Attrs{
+		Generation: strconv.FormatInt(w.Attrs().Generation, 10),
+		Metadata:   w.Attrs().Metadata,
+	}, nil
+}
+
+func (g *gcsClient) Copy(ctx context.Context, from, to Path) (*Attrs, error) {
+	attrs, err := g.object(to).CopierFrom(g.object(from)).Run(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, fmt.Errorf("%s: %w", from.String(), ErrObjectNotExist)
+		}
+		return nil, fmt.Errorf("copy %s -> %s: %w", from.String(), to.String(), err)
+	}
+	return &Attrs{
+		Generation: strconv.FormatInt(attrs.Generation, 10),
+		Metadata:   attrs.Metadata,
+	}, nil
+}
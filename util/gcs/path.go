@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gcs reads and writes TestGrid state to a cloud object store.
+//
+// Despite the package name, the storage backend is pluggable: a Path may
+// point at a gs://, s3://, or azblob:// URL, and Client implementations
+// exist for all three. GCS remains the default and best-supported backend.
+package gcs
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// schemes lists the object-store URL schemes TestGrid knows how to read and
+// write.
+var schemes = map[string]bool{
+	"gs":     true,
+	"s3":     true,
+	"azblob": true,
+}
+
+// Path parses a gs://, s3://, or azblob:// URL into a bucket and object name.
+type Path struct {
+	url url.URL
+}
+
+// NewPath parses s into a Path, validating that its scheme is supported.
+func NewPath(s string) (*Path, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", s, err)
+	}
+	return newPath(u)
+}
+
+func newPath(u *url.URL) (*Path, error) {
+	if !schemes[u.Scheme] {
+		return nil, fmt.Errorf("%q: scheme must be one of gs://, s3://, azblob://, not %q", u.String(), u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q: missing bucket", u.String())
+	}
+	var p Path
+	p.url = *u
+	return &p, nil
+}
+
+// String returns the path as a fully qualified URL, e.g. gs://bucket/object.
+func (p Path) String() string {
+	return p.url.String()
+}
+
+// Scheme returns the backend this path addresses: gs, s3, or azblob.
+func (p Path) Scheme() string {
+	return p.url.Scheme
+}
+
+// Bucket returns the bucket (or container, for Azure) component of the path.
+func (p Path) Bucket() string {
+	return p.url.Host
+}
+
+// Object returns the object (blob key) component of the path.
+func (p Path) Object() string {
+	return strings.TrimPrefix(p.url.Path, "/")
+}
+
+// ResolveReference resolves ref against p, as url.URL.ResolveReference does,
+// returning a new Path. The result must keep the same scheme as p.
+func (p Path) ResolveReference(ref *url.URL) (*Path, error) {
+	u := p.url.ResolveReference(ref)
+	u.Scheme = p.url.Scheme
+	return newPath(u)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3Client implements Client atop Amazon S3. Conditional writes use S3's
+// If-Match / If-None-Match request headers in place of GCS generation
+// preconditions.
+type s3Client struct {
+	client *s3.S3
+}
+
+func newS3Client(ctx context.Context, creds string) (Client, error) {
+	opts := session.Options{SharedConfigState: session.SharedConfigEnable}
+	if creds != "" {
+		opts.Profile = creds
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("session.NewSessionWithOptions: %w", err)
+	}
+	return &s3Client{client: s3.New(sess)}, nil
+}
+
+func (s *s3Client) Open(ctx context.Context, path Path) (io.ReadCloser, *Attrs, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(path.Bucket()),
+		Key:    aws.String(path.Object()),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil, fmt.Errorf("%s: %w", path.String(), ErrObjectNotExist)
+		}
+		return nil, nil, fmt.Errorf("GetObject(%s): %w", path.String(), err)
+	}
+	return out.Body, &Attrs{Generation: aws.StringValue(out.ETag), Metadata: aws.StringValueMap(out.Metadata)}, nil
+}
+
+func (s *s3Client) Upload(ctx context.Context, path Path, buf []byte, worldReadable bool, cacheControl string, metadata map[string]string, precondition Precondition) (*Attrs, error) {
+	in := &s3.PutObjectInput{
+		Bucket: aws.String(path.Bucket()),
+		Key:    aws.String(path.Object()),
+		Body:   bytes.NewReader(buf),
+	}
+	if cacheControl != "" {
+		in.CacheControl = aws.String(cacheControl)
+	}
+	if len(metadata) != 0 {
+		in.Metadata = aws.StringMap(metadata)
+	}
+	if worldReadable {
+		in.ACL = aws.String(s3.ObjectCannedACLPublicRead)
+	}
+	switch {
+	case precondition.IfAbsent:
+		in.IfNoneMatch = aws.String("*")
+	case precondition.Generation != "":
+		in.IfMatch = aws.String(precondition.Generation)
+	}
+
+	out, err := s.client.PutObjectWithContext(ctx, in)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == "PreconditionFailed" || aerr.Code() == "ConditionalRequestConflict") {
+			return nil, fmt.Errorf("precondition failed for %s: %w", path.String(), err)
+		}
+		return nil, fmt.Errorf("PutObject(%s): %w", path.String(), err)
+	}
+	return &Attrs{Generation: aws.StringValue(out.ETag)}, nil
+}
+
+func (s *s3Client) Copy(ctx context.Context, from, to Path) (*Attrs, error) {
+	out, err := s.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(to.Bucket()),
+		Key:        aws.String(to.Object()),
+		CopySource: aws.String(from.Bucket() + "/" + from.Object()),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, fmt.Errorf("%s: %w", from.String(), ErrObjectNotExist)
+		}
+		return nil, fmt.Errorf("copy %s -> %s: %w", from.String(), to.String(), err)
+	}
+	if out.CopyObjectResult == nil {
+		return &Attrs{}, nil
+	}
+	return &Attrs{Generation: aws.StringValue(out.CopyObjectResult.ETag)}, nil
+}
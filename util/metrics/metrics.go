@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics declares the metric types TestGrid components report,
+// independent of the monitoring backend that ultimately stores them.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Int64 tracks the most recent value of a gauge, broken down by fields.
+type Int64 interface {
+	Set(n int64, fields ...string)
+}
+
+// Counter tracks a monotonically increasing value, broken down by fields.
+type Counter interface {
+	Add(n int64, fields ...string)
+}
+
+// Duration tracks the most recently observed duration, broken down by
+// fields.
+type Duration interface {
+	Set(d time.Duration, fields ...string)
+}
+
+// Histogram tracks the distribution of observed values, broken down by
+// fields.
+type Histogram interface {
+	Observe(v float64, fields ...string)
+}
+
+// Cycle represents a single in-flight unit of work started by Cyclic.Start.
+type Cycle interface {
+	// Success marks the cycle as having completed successfully.
+	Success()
+	// Fail marks the cycle as having failed.
+	Fail()
+}
+
+// Cyclic counts how many times a repeating unit of work has run, and
+// whether each run succeeded or failed.
+type Cyclic interface {
+	Start() Cycle
+}
+
+// Factory creates the metrics a component reports.
+type Factory interface {
+	NewCyclic(component string) Cyclic
+	NewDuration(name, help string, fields ...string) Duration
+	NewInt64(name, help string, fields ...string) Int64
+	NewCounter(name, help string, fields ...string) Counter
+	// NewHistogram creates a Histogram with the given bucket upper bounds.
+	NewHistogram(name, help string, buckets []float64, fields ...string) Histogram
+}
+
+// Reporter accumulates ad hoc metrics for components, like config_merger,
+// that report a handful of values on each cycle rather than wiring a full
+// Factory.
+type Reporter struct {
+	mets []reportable
+}
+
+type reportable interface {
+	report(log logrus.FieldLogger)
+}
+
+// Int64 registers and returns a new gauge metric.
+func (r *Reporter) Int64(name, help string, log logrus.FieldLogger, fields ...string) Int64 {
+	m := &reportedInt64{name: name, values: map[string]int64{}}
+	r.mets = append(r.mets, m)
+	return m
+}
+
+// Counter registers and returns a new counter metric.
+func (r *Reporter) Counter(name, help string, log logrus.FieldLogger, fields ...string) Counter {
+	m := &reportedCounter{name: name, values: map[string]int64{}}
+	r.mets = append(r.mets, m)
+	return m
+}
+
+// Report logs every metric registered on r every freq, until ctx expires.
+// pusher, if non-nil, additionally pushes values to an external monitoring
+// backend.
+func (r *Reporter) Report(ctx context.Context, pusher Pusher, freq time.Duration) {
+	log := logrus.WithField("component", "metrics")
+	ticker := time.NewTicker(freq)
+	defer ticker.Stop()
+	for {
+		for _, m := range r.mets {
+			m.report(log)
+		}
+		if pusher != nil {
+			pusher.Push(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Pusher forwards a Reporter's metrics to an external monitoring backend.
+type Pusher interface {
+	Push(ctx context.Context)
+}
+
+type reportedInt64 struct {
+	name   string
+	values map[string]int64
+}
+
+func (m *reportedInt64) Set(n int64, fields ...string) {
+	m.values[key(fields)] = n
+}
+
+func (m *reportedInt64) report(log logrus.FieldLogger) {
+	for k, v := range m.values {
+		log.WithFields(logrus.Fields{"metric": m.name, "labels": k}).Debug(v)
+	}
+}
+
+type reportedCounter struct {
+	name   string
+	values map[string]int64
+}
+
+func (m *reportedCounter) Add(n int64, fields ...string) {
+	m.values[key(fields)] += n
+}
+
+func (m *reportedCounter) report(log logrus.FieldLogger) {
+	for k, v := range m.values {
+		log.WithFields(logrus.Fields{"metric": m.name, "labels": k}).Debug(v)
+	}
+}
+
+func key(fields []string) string {
+	out := ""
+	for i, f := range fields {
+		if i > 0 {
+			out += "|"
+		}
+		out += f
+	}
+	return out
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package prometheus implements util/metrics on top of the Prometheus
+// client library.
+package prometheus
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/GoogleCloudPlatform/testgrid/util/metrics"
+)
+
+// Valuer exposes a metric's current value(s), keyed by its label values
+// joined with "|", for tests and debugging.
+type Valuer interface {
+	Values() map[string]float64
+}
+
+// labeled collects a metric's declared field (label) names, in the order
+// they were declared, so Values() can report them in that same order
+// regardless of how the underlying vector happens to store labels.
+type labeled struct {
+	fields []string
+}
+
+func (l labeled) key(m *dto.Metric) string {
+	have := make(map[string]string, len(m.Label))
+	for _, lp := range m.Label {
+		have[lp.GetName()] = lp.GetValue()
+	}
+	vals := make([]string, len(l.fields))
+	for i, f := range l.fields {
+		vals[i] = have[f]
+	}
+	return strings.Join(vals, "|")
+}
+
+func collect(c prometheus.Collector) []*dto.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var out []*dto.Metric
+	for m := range ch {
+		var dtoM dto.Metric
+		if err := m.Write(&dtoM); err != nil {
+			continue
+		}
+		out = append(out, &dtoM)
+	}
+	return out
+}
+
+type int64Metric struct {
+	labeled
+	vec *prometheus.GaugeVec
+}
+
+// NewInt64 creates a Prometheus gauge metric.
+func NewInt64(name, help string, fields ...string) metrics.Int64 {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, fields)
+	prometheus.MustRegister(vec)
+	return &int64Metric{labeled{fields}, vec}
+}
+
+func (m *int64Metric) Set(n int64, fields ...string) {
+	m.vec.WithLabelValues(fields...).Set(float64(n))
+}
+
+func (m *int64Metric) Values() map[string]float64 {
+	out := map[string]float64{}
+	for _, dtoM := range collect(m.vec) {
+		out[m.key(dtoM)] = dtoM.GetGauge().GetValue()
+	}
+	return out
+}
+
+type counterMetric struct {
+	labeled
+	vec *prometheus.CounterVec
+}
+
+// NewCounter creates a Prometheus counter metric.
+func NewCounter(name, help string, fields ...string) metrics.Counter {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, fields)
+	prometheus.MustRegister(vec)
+	return &counterMetric{labeled{fields}, vec}
+}
+
+func (m *counterMetric) Add(n int64, fields ...string) {
+	m.vec.WithLabelValues(fields...).Add(float64(n))
+}
+
+func (m *counterMetric) Values() map[string]float64 {
+	out := map[string]float64{}
+	for _, dtoM := range collect(m.vec) {
+		out[m.key(dtoM)] = dtoM.GetCounter().GetValue()
+	}
+	return out
+}
+
+type durationMetric struct {
+	labeled
+	vec *prometheus.GaugeVec
+}
+
+// NewDuration creates a Prometheus gauge metric, reported in seconds.
+func NewDuration(name, help string, fields ...string) metrics.Duration {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, fields)
+	prometheus.MustRegister(vec)
+	return &durationMetric{labeled{fields}, vec}
+}
+
+func (m *durationMetric) Set(d time.Duration, fields ...string) {
+	m.vec.WithLabelValues(fields...).Set(d.Seconds())
+}
+
+func (m *durationMetric) Values() map[string]float64 {
+	out := map[string]float64{}
+	for _, dtoM := range collect(m.vec) {
+		out[m.key(dtoM)] = dtoM.GetGauge().GetValue()
+	}
+	return out
+}
+
+type histogramMetric struct {
+	labeled
+	vec *prometheus.HistogramVec
+}
+
+// NewHistogram creates a Prometheus histogram metric with the given bucket
+// upper bounds.
+func NewHistogram(name, help string, buckets []float64, fields ...string) metrics.Histogram {
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, fields)
+	prometheus.MustRegister(vec)
+	return &histogramMetric{labeled{fields}, vec}
+}
+
+func (m *histogramMetric) Observe(v float64, fields ...string) {
+	m.vec.WithLabelValues(fields...).Observe(v)
+}
+
+// Values returns the cumulative count observed in each bucket, keyed by
+// "<label values joined by |>|le=<bucket upper bound>", including the
+// implicit le=+Inf bucket (the total observation count).
+func (m *histogramMetric) Values() map[string]float64 {
+	out := map[string]float64{}
+	for _, dtoM := range collect(m.vec) {
+		key := m.key(dtoM)
+		for _, b := range dtoM.GetHistogram().GetBucket() {
+			out[fmt.Sprintf("%s|le=%v", key, b.GetUpperBound())] = float64(b.GetCumulativeCount())
+		}
+		out[fmt.Sprintf("%s|le=+Inf", key)] = float64(dtoM.GetHistogram().GetSampleCount())
+	}
+	return out
+}
+
+type cyclicMetric struct {
+	vec *prometheus.CounterVec
+}
+
+// NewCyclic creates a Prometheus counter metric tracking successes and
+// failures of component's repeating unit of work, labeled by "result".
+func NewCyclic(component string) metrics.Cyclic {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: component + "_cycles",
+		Help: fmt.Sprintf("Cycles of %s, by result", component),
+	}, []string{"result"})
+	prometheus.MustRegister(vec)
+	return &cyclicMetric{vec: vec}
+}
+
+func (c *cyclicMetric) Start() metrics.Cycle {
+	return cycle{c}
+}
+
+type cycle struct {
+	metric *cyclicMetric
+}
+
+func (c cycle) Success() { c.metric.vec.WithLabelValues("success").Inc() }
+func (c cycle) Fail()    { c.metric.vec.WithLabelValues("failure").Inc() }
+
+// Factory creates Prometheus-backed metrics.
+type Factory struct{}
+
+// NewCyclic implements metrics.Factory.
+func (Factory) NewCyclic(component string) metrics.Cyclic { return NewCyclic(component) }
+
+// NewDuration implements metrics.Factory.
+func (Factory) NewDuration(name, help string, fields ...string) metrics.Duration {
+	return NewDuration(name, help, fields...)
+}
+
+// NewInt64 implements metrics.Factory.
+func (Factory) NewInt64(name, help string, fields ...string) metrics.Int64 {
+	return NewInt64(name, help, fields...)
+}
+
+// NewCounter implements metrics.Factory.
+func (Factory) NewCounter(name, help string, fields ...string) metrics.Counter {
+	return NewCounter(name, help, fields...)
+}
+
+// NewHistogram implements metrics.Factory.
+func (Factory) NewHistogram(name, help string, buckets []float64, fields ...string) metrics.Histogram {
+	return NewHistogram(name, help, buckets, fields...)
+}
@@ -196,3 +196,77 @@ func TestCounterAdd(t *testing.T) {
 		})
 	}
 }
+
+func TestHistogramObserve(t *testing.T) {
+	buckets := []float64{1, 5, 10}
+	cases := []struct {
+		name     string
+		fields   []string
+		observes []map[float64][]string
+		want     map[string]float64
+	}{
+		{
+			name: "zero",
+			want: map[string]float64{},
+		},
+		{
+			name:   "basic",
+			fields: []string{"component"},
+			observes: []map[float64][]string{
+				{3: {"updater"}},
+			},
+			want: map[string]float64{
+				"updater|le=1":    0,
+				"updater|le=5":    1,
+				"updater|le=10":   1,
+				"updater|le=+Inf": 1,
+			},
+		},
+		{
+			name:   "cumulative across buckets",
+			fields: []string{"component"},
+			observes: []map[float64][]string{
+				{0.5: {"updater"}},
+				{3: {"updater"}},
+				{7: {"updater"}},
+				{20: {"updater"}},
+			},
+			want: map[string]float64{
+				"updater|le=1":    1,
+				"updater|le=5":    2,
+				"updater|le=10":   3,
+				"updater|le=+Inf": 4,
+			},
+		},
+		{
+			name:   "fields",
+			fields: []string{"component", "source"},
+			observes: []map[float64][]string{
+				{3: {"updater", "prow"}},
+				{8: {"updater", "prow"}},
+			},
+			want: map[string]float64{
+				"updater|prow|le=1":    0,
+				"updater|prow|le=5":    1,
+				"updater|prow|le=10":   2,
+				"updater|prow|le=+Inf": 2,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mName := strings.Replace(tc.name, " ", "_", -1) + "_histogram"
+			m := NewHistogram(mName, "fake desc", buckets, tc.fields...)
+			for _, observe := range tc.observes {
+				for v, fields := range observe {
+					m.Observe(v, fields...)
+				}
+			}
+			got := m.(Valuer).Values()
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Observe() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}